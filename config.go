@@ -0,0 +1,172 @@
+/*
+   Copyright (C) 2023 Torkus
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as
+   published by the Free Software Foundation, either version 3 of the
+   License, or (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// default path to the mirror config file, relative to the process's working directory.
+const default_config_path = "mirror.json"
+
+// AddonOverride customises a single addon's mirrored metadata without
+// forking the script: a different display name, a different patch list (eg
+// to add/drop a flavour), or a different destination repo name.
+type AddonOverride struct {
+	Name      string   `json:"name,omitempty"`
+	PatchList []string `json:"patch,omitempty"`
+	DestSlug  string   `json:"dest_slug,omitempty"` // destination repo name, if different from the source slug
+}
+
+// SourceConfig declares a single upstream registry to mirror addons from.
+// today only "tukui" is supported, but the `type` field leaves room for
+// "wowinterface"/"curseforge"-style sources.
+type SourceConfig struct {
+	Type string `json:"type"` // "tukui"
+}
+
+// ReleaseHostConfig declares where mirrored addons are released to.
+type ReleaseHostConfig struct {
+	Type             string `json:"type"` // "github" or "gitea"
+	Owner            string `json:"owner"`
+	BaseURL          string `json:"base_url,omitempty"`           // gitea only
+	CloneURLTemplate string `json:"clone_url_template,omitempty"` // github defaults to default_github_clone_url_template if unset; required for gitea
+	TokenEnvVar      string `json:"token_envvar,omitempty"`       // defaults to "GITHUB_TOKEN"
+}
+
+// MirrorConfig is the top-level shape of `mirror.json`: the sources to pull
+// addons from, an allow/deny list of slugs, per-addon overrides, and the
+// release host to publish mirrored releases to.
+type MirrorConfig struct {
+	Sources     []SourceConfig           `json:"sources"`
+	Allow       []string                 `json:"allow,omitempty"`
+	Deny        []string                 `json:"deny,omitempty"`
+	Overrides   map[string]AddonOverride `json:"overrides,omitempty"` // keyed by source slug
+	ReleaseHost ReleaseHostConfig        `json:"release_host"`
+}
+
+// LoadConfig reads and parses the mirror config file at `path`.
+func LoadConfig(path string) (*MirrorConfig, error) {
+	config_bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &MirrorConfig{}
+	err = json.Unmarshal(config_bytes, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// builds the `IMirror` described by `source`.
+func build_mirror_source(source SourceConfig) (IMirror, error) {
+	switch source.Type {
+	case "tukui":
+		return TukuiMirror{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported mirror source type: %s", source.Type)
+	}
+}
+
+// builds the `IReleaseHost` described by `cfg`, authenticating with the token
+// found in envvar `cfg.TokenEnvVar` ("GITHUB_TOKEN" if unset).
+func build_release_host(cfg ReleaseHostConfig) (IReleaseHost, error) {
+	token := resolve_token(cfg.TokenEnvVar)
+	switch cfg.Type {
+	case "github":
+		clone_url_template := cfg.CloneURLTemplate
+		if clone_url_template == "" {
+			clone_url_template = default_github_clone_url_template
+		}
+		return NewGitHubHost(token, cfg.Owner, clone_url_template), nil
+	case "gitea":
+		ensure(cfg.BaseURL != "", "gitea release host requires a base_url")
+		ensure(cfg.CloneURLTemplate != "", "gitea release host requires a clone_url_template")
+		return NewGiteaHost(cfg.BaseURL, token, cfg.Owner, cfg.CloneURLTemplate)
+	default:
+		return nil, fmt.Errorf("unsupported release host type: %s", cfg.Type)
+	}
+}
+
+// pulls a token out of envvar `envvar`, falling back to "GITHUB_TOKEN" if unset.
+func resolve_token(envvar string) string {
+	if envvar == "" {
+		envvar = "GITHUB_TOKEN"
+	}
+	token, present := os.LookupEnv(envvar)
+	ensure(present, fmt.Sprintf("envvar %s not set.", envvar))
+	return token
+}
+
+// FilteredMirror wraps an `IMirror` with a fixed, already filtered/overridden
+// addon list, so `apply_addon_config`'s output can still be handed to `mirror`
+// as a plain `IMirror`.
+type FilteredMirror struct {
+	IMirror
+	addon_list []Addon
+}
+
+func (m FilteredMirror) fetch_addon_list() []Addon {
+	return m.addon_list
+}
+
+// filters `addon_list` through `cfg`'s allow/deny lists and applies any
+// per-addon overrides found in `cfg.Overrides`.
+func apply_addon_config(addon_list []Addon, cfg *MirrorConfig) []Addon {
+	allow := string_set(cfg.Allow)
+	deny := string_set(cfg.Deny)
+
+	result := []Addon{}
+	for _, addon := range addon_list {
+		if len(allow) > 0 && !allow[addon.Slug] {
+			continue
+		}
+		if deny[addon.Slug] {
+			continue
+		}
+		if override, present := cfg.Overrides[addon.Slug]; present {
+			addon = apply_override(addon, override)
+		}
+		result = append(result, addon)
+	}
+	return result
+}
+
+func apply_override(addon Addon, override AddonOverride) Addon {
+	if override.Name != "" {
+		addon.Name = override.Name
+	}
+	if len(override.PatchList) > 0 {
+		addon.PatchList = override.PatchList
+	}
+	if override.DestSlug != "" {
+		addon.Slug = override.DestSlug
+	}
+	return addon
+}
+
+func string_set(list []string) map[string]bool {
+	set := map[string]bool{}
+	for _, item := range list {
+		set[item] = true
+	}
+	return set
+}
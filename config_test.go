@@ -0,0 +1,106 @@
+/*
+   Copyright (C) 2023 Torkus
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as
+   published by the Free Software Foundation, either version 3 of the
+   License, or (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyAddonConfigAllowDeny(t *testing.T) {
+	addon_list := []Addon{
+		{Slug: "elvui", Name: "ElvUI"},
+		{Slug: "tukui", Name: "Tukui"},
+		{Slug: "shadowed-unit-frames", Name: "ShadowedUnitFrames"},
+	}
+
+	cases := []struct {
+		name       string
+		cfg        MirrorConfig
+		want_slugs []string
+	}{
+		{
+			name:       "no allow/deny passes everything through",
+			cfg:        MirrorConfig{},
+			want_slugs: []string{"elvui", "tukui", "shadowed-unit-frames"},
+		},
+		{
+			name:       "allow narrows to just the listed slugs",
+			cfg:        MirrorConfig{Allow: []string{"elvui", "tukui"}},
+			want_slugs: []string{"elvui", "tukui"},
+		},
+		{
+			name:       "deny removes the listed slugs",
+			cfg:        MirrorConfig{Deny: []string{"tukui"}},
+			want_slugs: []string{"elvui", "shadowed-unit-frames"},
+		},
+		{
+			name:       "deny wins when a slug is both allowed and denied",
+			cfg:        MirrorConfig{Allow: []string{"elvui", "tukui"}, Deny: []string{"tukui"}},
+			want_slugs: []string{"elvui"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := apply_addon_config(addon_list, &c.cfg)
+			got_slugs := []string{}
+			for _, addon := range got {
+				got_slugs = append(got_slugs, addon.Slug)
+			}
+			if !reflect.DeepEqual(got_slugs, c.want_slugs) {
+				t.Errorf("apply_addon_config(...) slugs = %v, want %v", got_slugs, c.want_slugs)
+			}
+		})
+	}
+}
+
+func TestApplyAddonConfigOverrideAppliedAfterFilter(t *testing.T) {
+	addon_list := []Addon{
+		{Slug: "elvui", Name: "ElvUI", PatchList: []string{"10.1.0"}},
+		{Slug: "tukui", Name: "Tukui", PatchList: []string{"10.1.0"}},
+	}
+	cfg := MirrorConfig{
+		Deny: []string{"tukui"},
+		Overrides: map[string]AddonOverride{
+			"elvui": {Name: "ElvUI (mirror)", PatchList: []string{"10.1.0", "1.14.3"}, DestSlug: "elvui-mirror"},
+			"tukui": {Name: "should never be applied"},
+		},
+	}
+
+	got := apply_addon_config(addon_list, &cfg)
+	if len(got) != 1 {
+		t.Fatalf("expected the denied addon to be filtered before overrides run, got %d addons: %v", len(got), got)
+	}
+
+	want := Addon{Slug: "elvui-mirror", Name: "ElvUI (mirror)", PatchList: []string{"10.1.0", "1.14.3"}}
+	if !reflect.DeepEqual(got[0], want) {
+		t.Errorf("apply_addon_config(...)[0] = %+v, want %+v", got[0], want)
+	}
+}
+
+func TestBuildReleaseHostGiteaRequiresCloneURLTemplate(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "test-token")
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected build_release_host to panic without a clone_url_template")
+		}
+	}()
+	build_release_host(ReleaseHostConfig{Type: "gitea", BaseURL: "https://gitea.example.org", Owner: "ogri-la"})
+}
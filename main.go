@@ -18,7 +18,6 @@
 package main
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -29,11 +28,20 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
-
-	"github.com/google/go-github/v52/github"
-	"golang.org/x/oauth2"
+	"sync"
 )
 
+// default clone url template for addons hosted on Github, taking the owner then the slug.
+const default_github_clone_url_template = "ssh://git@github.com/%s/%s"
+
+// directory each addon is cloned into and worked on, relative to the process's
+// working directory: "work/elvui", "work/tukui", etc. keeps each addon
+// isolated from the others so concurrent workers never collide.
+const mirror_work_dir = "work"
+
+// default number of addons mirrored concurrently, overridden by MIRROR_CONCURRENCY.
+const default_mirror_concurrency = 4
+
 type Addon struct {
 	Slug      string   `json:"slug"` // "elvui"
 	Name      string   `json:"name"` // "ElvUI"
@@ -224,22 +232,16 @@ func write_release_json(release_json string, addon_output_dir string) string {
 	return release_json_output_path
 }
 
-// returns the most recent tag of the addon's git repository at
-// `addon_output_dir` to be compared against the version returned by the API.
-func fetch_addon_version(addon_output_dir string) string {
-	rc, _stdout, _stderr := run_cmd("git describe --tags --abbrev=0", addon_output_dir)
-	if rc != 0 {
-		if strings.Contains(_stderr, "fatal: No names found, cannot describe anything.") ||
-			strings.Contains(_stderr, "fatal: No tags can describe") {
-			return "" // no tags, no worries
-		}
-		ensure(rc == 0, "failed to fetch latest tag: "+_stderr)
-	}
-	return _stdout
-}
-
 // tags the addon's git repository at `addon_output_dir` with `version`.
+// idempotent: if `version` is already tagged (eg a previous run pushed the
+// tag but then failed before `create_tag_release` completed), this is a
+// no-op rather than a `git tag` failure, so a retry can still get as far as
+// creating the host release.
 func tag_addon(version string, addon_output_dir string) {
+	if tag_exists(version, addon_output_dir) {
+		stderr(fmt.Sprintf("tag %s already exists, not re-tagging", version))
+		return
+	}
 	cmd_list := []string{
 		fmt.Sprintf("git commit -m %s --allow-empty", version),
 		"git tag " + version,
@@ -249,12 +251,18 @@ func tag_addon(version string, addon_output_dir string) {
 	run_all_cmd(cmd_list, addon_output_dir)
 }
 
-// resets the git repository for the given `addon` by deleting and re-cloning it.
-// ensures no errant tags or weird repository state are present.
-func fetch_repo(addon Addon, script_path string) {
+// returns true if `version` already exists as a tag in the git repository at `addon_output_dir`.
+func tag_exists(version string, addon_output_dir string) bool {
+	rc, _, _ := run_cmd("git rev-parse "+version, addon_output_dir)
+	return rc == 0
+}
+
+// resets the git repository for the given `addon` by deleting and re-cloning it
+// from `host`. ensures no errant tags or weird repository state are present.
+func fetch_repo(addon Addon, script_path string, host IReleaseHost) {
 	cmd_list := []string{
 		fmt.Sprintf("rm -rf %s", addon.Slug),
-		"git clone ssh://git@github.com/ogri-la/" + addon.Slug,
+		"git clone " + host.CloneURL(addon.Slug),
 	}
 	run_all_cmd(cmd_list, script_path)
 }
@@ -268,30 +276,13 @@ func guess_media_type(path string) string {
 	return mime
 }
 
-func create_tag_release(addon Addon, token string, asset_list []string) {
-	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: token},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
-
-	// https://docs.github.com/en/rest/releases/releases?apiVersion=2022-11-28#create-a-release
-	release := github.RepositoryRelease{
-		TagName:    github.String(addon.Version),
-		MakeLatest: github.String("true"),
-	}
-	release_result, _, err := client.Repositories.CreateRelease(ctx, "ogri-la", addon.Slug, &release)
-	panicOnErr(err, "creating a Github release")
+// creates a release for `addon` on `host` with body `release_notes`,
+// uploading each path in `asset_list`.
+func create_tag_release(addon Addon, host IReleaseHost, release_notes string, asset_list []string) {
+	release, err := host.CreateRelease(addon.Slug, addon.Version, release_notes)
+	panicOnErr(err, "creating a release")
 	for _, asset_path := range asset_list {
-		upload_opts := github.UploadOptions{
-			Name:      filepath.Base(asset_path),
-			Label:     filepath.Base(asset_path),
-			MediaType: guess_media_type(asset_path),
-		}
-		fh, err := os.Open(asset_path)
-		panicOnErr(err, "opening asset: "+asset_path)
-		_, _, err = client.Repositories.UploadReleaseAsset(ctx, "ogri-la", addon.Slug, release_result.GetID(), &upload_opts, fh)
+		err := host.UploadAsset(addon.Slug, release.ID, asset_path)
 		panicOnErr(err, "uploading asset: "+asset_path)
 	}
 }
@@ -303,34 +294,161 @@ func github_token() string {
 	return token
 }
 
-func mirror(app IMirror, token string) {
-	script_path, err := os.Getwd()
-	panicOnErr(err, "fetching the current working directory")
-	for _, addon := range app.fetch_addon_list() {
-		fetch_repo(addon, script_path)
-
-		// "/path/to/output/dir/elvui/"
-		addon_output_dir, err := filepath.Abs(addon.Slug)
-		panicOnErr(err, "creating an absolute path for addon's output")
-
-		current_version := fetch_addon_version(addon_output_dir)
-		latest_version := addon.Version
-		if current_version == latest_version {
-			stderr(fmt.Sprintf("%s == %s, skipping", current_version, latest_version))
-			continue
+// builds the list of addon slugs in `addon_list`.
+func addon_slugs(addon_list []Addon) []string {
+	slug_list := []string{}
+	for _, addon := range addon_list {
+		slug_list = append(slug_list, addon.Slug)
+	}
+	return slug_list
+}
+
+// reads the number of addons to mirror concurrently from envvar
+// `MIRROR_CONCURRENCY`, falling back to `default_mirror_concurrency`.
+func mirror_concurrency() int {
+	raw, present := os.LookupEnv("MIRROR_CONCURRENCY")
+	if !present {
+		return default_mirror_concurrency
+	}
+	n, err := strconv.Atoi(raw)
+	panicOnErr(err, "parsing MIRROR_CONCURRENCY")
+	ensure(n > 0, "MIRROR_CONCURRENCY must be a positive integer")
+	return n
+}
+
+// the outcome of mirroring a single addon.
+type mirror_result struct {
+	addon   Addon
+	skipped bool
+	err     error
+}
+
+// MirrorSummary tallies the outcome of a `mirror` run so that a single failed
+// addon doesn't hide the fact that every other addon succeeded (or vice versa).
+type MirrorSummary struct {
+	Updated []Addon
+	Skipped []Addon
+	Failed  []mirror_result
+}
+
+// prints a one-line tally followed by a line per failed addon.
+func (summary MirrorSummary) Print() {
+	stderr(fmt.Sprintf("mirror run complete: %d updated, %d skipped, %d failed",
+		len(summary.Updated), len(summary.Skipped), len(summary.Failed)))
+	for _, failure := range summary.Failed {
+		stderr(fmt.Sprintf("  FAILED %s: %s", failure.addon.Slug, failure.err))
+	}
+}
+
+// mirrors a single `addon` in its own working directory so concurrent workers
+// never collide. `current_version` is the addon's latest tag on `host`, or ""
+// if it has never been mirrored. panics raised anywhere along the way (the
+// historic panicOnErr/ensure style) are recovered here and turned into an
+// error on the result, so one bad addon can't abort the whole run.
+func mirror_addon(addon Addon, current_version string, app IMirror, host IReleaseHost) (result mirror_result) {
+	result.addon = addon
+	defer func() {
+		if r := recover(); r != nil {
+			result.err = fmt.Errorf("%v", r)
 		}
-		stderr(fmt.Sprintf("update detected for %s: '%s' => '%s'", addon.Name, current_version, latest_version))
-		zip_output_path := app.download_addon(addon, addon_output_dir)
+	}()
+
+	latest_version := addon.Version
+	if current_version == latest_version {
+		stderr(fmt.Sprintf("%s == %s, skipping", current_version, latest_version))
+		result.skipped = true
+		return
+	}
+	stderr(fmt.Sprintf("update detected for %s: '%s' => '%s'", addon.Name, current_version, latest_version))
+
+	fetch_repo(addon, mirror_work_dir, host)
+
+	// "/path/to/work/elvui/"
+	addon_output_dir, err := filepath.Abs(filepath.Join(mirror_work_dir, addon.Slug))
+	panicOnErr(err, "creating an absolute path for addon's output")
+
+	zip_output_path := app.download_addon(addon, addon_output_dir)
+
+	zip_output_filename := filepath.Base(zip_output_path) // "elvui--3.33.zip"
+	release_json := gen_release_json(addon, zip_output_filename)
+	release_json_path := write_release_json(release_json, addon_output_dir)
+	release_notes := build_release_notes(addon, current_version, latest_version, zip_output_path)
 
-		zip_output_filename := filepath.Base(zip_output_path) // "elvui--3.33.zip"
-		release_json := gen_release_json(addon, zip_output_filename)
-		release_json_path := write_release_json(release_json, addon_output_dir)
+	tag_addon(addon.Version, addon_output_dir)
+	create_tag_release(addon, host, release_notes, []string{zip_output_path, release_json_path})
+	return
+}
+
+func mirror(app IMirror, host IReleaseHost) MirrorSummary {
+	err := os.MkdirAll(mirror_work_dir, os.FileMode(0755))
+	panicOnErr(err, "creating mirror work directory")
+
+	addon_list := app.fetch_addon_list()
+
+	// a single batched preflight check replaces what used to be a `git describe`
+	// and a fresh clone per addon just to decide whether it needs mirroring.
+	latest_tag_map, err := host.LatestReleaseTags(addon_slugs(addon_list))
+	panicOnErr(err, "fetching latest release tags")
+
+	work_queue := make(chan Addon)
+	result_queue := make(chan mirror_result)
+
+	var workers sync.WaitGroup
+	for i := 0; i < mirror_concurrency(); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for addon := range work_queue {
+				result_queue <- mirror_addon(addon, latest_tag_map[addon.Slug], app, host)
+			}
+		}()
+	}
 
-		tag_addon(addon.Version, addon_output_dir)
-		create_tag_release(addon, token, []string{zip_output_path, release_json_path})
+	go func() {
+		for _, addon := range addon_list {
+			work_queue <- addon
+		}
+		close(work_queue)
+	}()
+
+	go func() {
+		workers.Wait()
+		close(result_queue)
+	}()
+
+	summary := MirrorSummary{}
+	for result := range result_queue {
+		switch {
+		case result.err != nil:
+			summary.Failed = append(summary.Failed, result)
+		case result.skipped:
+			summary.Skipped = append(summary.Skipped, result.addon)
+		default:
+			summary.Updated = append(summary.Updated, result.addon)
+		}
 	}
+	return summary
 }
 
 func main() {
-	mirror(TukuiMirror{}, github_token())
+	config_path := default_config_path
+	if len(os.Args) > 1 {
+		config_path = os.Args[1]
+	}
+	cfg, err := LoadConfig(config_path)
+	panicOnErr(err, "loading mirror config: "+config_path)
+
+	host, err := build_release_host(cfg.ReleaseHost)
+	panicOnErr(err, "constructing release host")
+
+	for _, source_cfg := range cfg.Sources {
+		source, err := build_mirror_source(source_cfg)
+		panicOnErr(err, "constructing mirror source")
+
+		addon_list := apply_addon_config(source.fetch_addon_list(), cfg)
+		app := FilteredMirror{IMirror: source, addon_list: addon_list}
+
+		summary := mirror(app, host)
+		summary.Print()
+	}
 }
@@ -18,16 +18,11 @@
 package main
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 
-	"golang.org/x/oauth2"
-
-	"github.com/google/go-github/v52/github"
-
 	"testing"
 )
 
@@ -76,7 +71,7 @@ func (app DummyMirror2) download_addon(addon Addon, output_path string) string {
 	return _download_addon(addon, output_path)
 }
 
-func reset(token string) {
+func reset(host IReleaseHost) {
 	script_path, err := os.Getwd()
 	panicOnErr(err, "fetching the current working directory")
 	addon_list := []Addon{
@@ -86,17 +81,9 @@ func reset(token string) {
 	for _, addon := range addon_list {
 		// delete any Github releases.
 		// if you reset the repos first, it leaves draft releases behind(?)
-		ctx := context.Background()
-		ts := oauth2.StaticTokenSource(
-			&oauth2.Token{AccessToken: token},
-		)
-		tc := oauth2.NewClient(ctx, ts)
-		client := github.NewClient(tc)
-		// https://docs.github.com/en/rest/releases/releases?apiVersion=2022-11-28#delete-a-release
-		opts := github.ListOptions{}
-		release_list, _, _ := client.Repositories.ListReleases(ctx, "ogri-la", addon.Slug, &opts)
+		release_list, _ := host.ListReleases(addon.Slug)
 		for _, release := range release_list {
-			_, err := client.Repositories.DeleteRelease(ctx, "ogri-la", addon.Slug, release.GetID())
+			err := host.DeleteRelease(addon.Slug, release.ID)
 			panicOnErr(err, "deleting release")
 		}
 
@@ -111,13 +98,13 @@ func reset(token string) {
 }
 
 func TestMirror(t *testing.T) {
-	token := github_token()
+	host := NewGitHubHost(github_token(), "ogri-la", default_github_clone_url_template)
 
-	reset(token)
+	reset(host)
 
 	release_one := DummyMirror{}
-	mirror(release_one, token)
+	mirror(release_one, host)
 
 	release_two := DummyMirror2{}
-	mirror(release_two, token)
+	mirror(release_two, host)
 }
@@ -0,0 +1,72 @@
+/*
+   Copyright (C) 2023 Torkus
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as
+   published by the Free Software Foundation, either version 3 of the
+   License, or (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMirrorConcurrency(t *testing.T) {
+	cases := []struct {
+		name  string
+		value string
+		unset bool
+		want  int
+	}{
+		{name: "falls back to the default when unset", unset: true, want: default_mirror_concurrency},
+		{name: "uses a valid override", value: "8", want: 8},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if c.unset {
+				os.Unsetenv("MIRROR_CONCURRENCY")
+			} else {
+				t.Setenv("MIRROR_CONCURRENCY", c.value)
+			}
+			got := mirror_concurrency()
+			if got != c.want {
+				t.Errorf("mirror_concurrency() = %d, want %d", got, c.want)
+			}
+		})
+	}
+}
+
+func TestMirrorConcurrencyPanicsOnInvalidValues(t *testing.T) {
+	cases := []struct {
+		name  string
+		value string
+	}{
+		{name: "not a number", value: "lots"},
+		{name: "zero", value: "0"},
+		{name: "negative", value: "-1"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv("MIRROR_CONCURRENCY", c.value)
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected mirror_concurrency() to panic for MIRROR_CONCURRENCY=%q", c.value)
+				}
+			}()
+			mirror_concurrency()
+		})
+	}
+}
@@ -0,0 +1,310 @@
+/*
+   Copyright (C) 2023 Torkus
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as
+   published by the Free Software Foundation, either version 3 of the
+   License, or (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.gitea.io/sdk/gitea"
+	"github.com/google/go-github/v52/github"
+	"github.com/shurcooL/githubv4"
+	"golang.org/x/oauth2"
+)
+
+// a release as reported back by whatever host is mirroring the addon.
+type Release struct {
+	ID      int64
+	TagName string
+}
+
+// IReleaseHost abstracts away the git forge a mirrored addon's releases are
+// pushed to, so the mirroring logic in `mirror` doesn't need to know or care
+// whether it's talking to Github, Gitea, or anything else.
+type IReleaseHost interface {
+	// returns the releases already present for `slug`.
+	ListReleases(slug string) ([]Release, error)
+	// creates a new release for `slug` tagged `tag`, with body `body`.
+	CreateRelease(slug string, tag string, body string) (Release, error)
+	// uploads the file at `asset_path` to the release `release_id` belonging to `slug`.
+	UploadAsset(slug string, release_id int64, asset_path string) error
+	// deletes the release `release_id` belonging to `slug`.
+	DeleteRelease(slug string, release_id int64) error
+	// returns the clone url for `slug` on this host.
+	CloneURL(slug string) string
+	// returns a map of slug => latest release tag name for each slug in
+	// `slug_list`, fetched in as few round-trips as the host allows. slugs
+	// with no releases yet are omitted from the result.
+	LatestReleaseTags(slug_list []string) (map[string]string, error)
+}
+
+// ---
+
+// GitHubHost is an `IReleaseHost` backed by github.com (or a Github Enterprise instance).
+type GitHubHost struct {
+	client             *github.Client
+	graphql_client     *githubv4.Client
+	owner              string
+	clone_url_template string // eg "ssh://git@github.com/%s/%s"
+}
+
+// NewGitHubHost returns a `GitHubHost` that creates releases under `owner`,
+// authenticating with `token`. `clone_url_template` is an `fmt.Sprintf`
+// template taking `owner` then `slug`, eg "ssh://git@github.com/%s/%s".
+func NewGitHubHost(token string, owner string, clone_url_template string) *GitHubHost {
+	ctx := context.Background()
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+	tc := oauth2.NewClient(ctx, ts)
+	return &GitHubHost{
+		client:             github.NewClient(tc),
+		graphql_client:     githubv4.NewClient(tc),
+		owner:              owner,
+		clone_url_template: clone_url_template,
+	}
+}
+
+// runs `fn` and, if it fails with a Github API rate-limit error, sleeps until
+// the limit resets and retries once more.
+func with_rate_limit_retry(fn func() error) error {
+	err := fn()
+	var rate_limit_err *github.RateLimitError
+	if errors.As(err, &rate_limit_err) {
+		sleep_duration := time.Until(rate_limit_err.Rate.Reset.Time)
+		if sleep_duration > 0 {
+			stderr(fmt.Sprintf("rate limited, sleeping until %s", rate_limit_err.Rate.Reset.Time))
+			time.Sleep(sleep_duration)
+		}
+		err = fn()
+	}
+	return err
+}
+
+func (host *GitHubHost) ListReleases(slug string) ([]Release, error) {
+	ctx := context.Background()
+	var release_list []*github.RepositoryRelease
+	err := with_rate_limit_retry(func() error {
+		var err error
+		release_list, _, err = host.client.Repositories.ListReleases(ctx, host.owner, slug, &github.ListOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := []Release{}
+	for _, release := range release_list {
+		result = append(result, Release{ID: release.GetID(), TagName: release.GetTagName()})
+	}
+	return result, nil
+}
+
+func (host *GitHubHost) CreateRelease(slug string, tag string, body string) (Release, error) {
+	ctx := context.Background()
+	// https://docs.github.com/en/rest/releases/releases?apiVersion=2022-11-28#create-a-release
+	release := github.RepositoryRelease{
+		TagName:    github.String(tag),
+		MakeLatest: github.String("true"),
+		Body:       github.String(body),
+	}
+	var release_result *github.RepositoryRelease
+	err := with_rate_limit_retry(func() error {
+		var err error
+		release_result, _, err = host.client.Repositories.CreateRelease(ctx, host.owner, slug, &release)
+		return err
+	})
+	if err != nil {
+		return Release{}, err
+	}
+	return Release{ID: release_result.GetID(), TagName: release_result.GetTagName()}, nil
+}
+
+func (host *GitHubHost) UploadAsset(slug string, release_id int64, asset_path string) error {
+	ctx := context.Background()
+	upload_opts := github.UploadOptions{
+		Name:      filepath.Base(asset_path),
+		Label:     filepath.Base(asset_path),
+		MediaType: guess_media_type(asset_path),
+	}
+	return with_rate_limit_retry(func() error {
+		fh, err := os.Open(asset_path)
+		if err != nil {
+			return err
+		}
+		defer fh.Close()
+		_, _, err = host.client.Repositories.UploadReleaseAsset(ctx, host.owner, slug, release_id, &upload_opts, fh)
+		return err
+	})
+}
+
+func (host *GitHubHost) DeleteRelease(slug string, release_id int64) error {
+	ctx := context.Background()
+	return with_rate_limit_retry(func() error {
+		_, err := host.client.Repositories.DeleteRelease(ctx, host.owner, slug, release_id)
+		return err
+	})
+}
+
+func (host *GitHubHost) CloneURL(slug string) string {
+	return fmt.Sprintf(host.clone_url_template, host.owner, slug)
+}
+
+// latestReleaseTagsQuery fetches, for every repository owned by `$owner`, the
+// tag name of its most recent release, one page of repositories at a time.
+type latestReleaseTagsQuery struct {
+	RepositoryOwner struct {
+		Repositories struct {
+			Nodes []struct {
+				Name     githubv4.String
+				Releases struct {
+					Nodes []struct {
+						TagName githubv4.String
+					}
+				} `graphql:"releases(last: 1)"`
+			}
+			PageInfo struct {
+				HasNextPage githubv4.Boolean
+				EndCursor   githubv4.String
+			}
+		} `graphql:"repositories(first: 100, after: $cursor)"`
+	} `graphql:"repositoryOwner(login: $owner)"`
+}
+
+// LatestReleaseTags fetches the latest release tag for every repository owned
+// by `host.owner` in a single batch of paginated Github GraphQL v4 queries,
+// rather than one REST call (and clone) per addon. `slug_list` narrows the
+// result down to the slugs the caller is actually interested in.
+func (host *GitHubHost) LatestReleaseTags(slug_list []string) (map[string]string, error) {
+	wanted := map[string]bool{}
+	for _, slug := range slug_list {
+		wanted[slug] = true
+	}
+
+	ctx := context.Background()
+	variables := map[string]interface{}{
+		"owner":  githubv4.String(host.owner),
+		"cursor": (*githubv4.String)(nil),
+	}
+
+	result := map[string]string{}
+	for {
+		var query latestReleaseTagsQuery
+		err := host.graphql_client.Query(ctx, &query, variables)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, repo := range query.RepositoryOwner.Repositories.Nodes {
+			slug := string(repo.Name)
+			if !wanted[slug] || len(repo.Releases.Nodes) == 0 {
+				continue
+			}
+			result[slug] = string(repo.Releases.Nodes[0].TagName)
+		}
+
+		if !bool(query.RepositoryOwner.Repositories.PageInfo.HasNextPage) {
+			break
+		}
+		variables["cursor"] = githubv4.NewString(query.RepositoryOwner.Repositories.PageInfo.EndCursor)
+	}
+
+	return result, nil
+}
+
+// ---
+
+// GiteaHost is an `IReleaseHost` backed by a self-hosted Gitea instance.
+type GiteaHost struct {
+	client             *gitea.Client
+	owner              string
+	clone_url_template string // eg "ssh://git@gitea.example.org/%s/%s"
+}
+
+// NewGiteaHost returns a `GiteaHost` talking to the Gitea instance at
+// `base_url`, creating releases under `owner`. `clone_url_template` is an
+// `fmt.Sprintf` template taking `owner` then `slug`.
+func NewGiteaHost(base_url string, token string, owner string, clone_url_template string) (*GiteaHost, error) {
+	client, err := gitea.NewClient(base_url, gitea.SetToken(token))
+	if err != nil {
+		return nil, err
+	}
+	return &GiteaHost{
+		client:             client,
+		owner:              owner,
+		clone_url_template: clone_url_template,
+	}, nil
+}
+
+func (host *GiteaHost) ListReleases(slug string) ([]Release, error) {
+	release_list, _, err := host.client.ListReleases(host.owner, slug, gitea.ListReleasesOptions{})
+	if err != nil {
+		return nil, err
+	}
+	result := []Release{}
+	for _, release := range release_list {
+		result = append(result, Release{ID: release.ID, TagName: release.TagName})
+	}
+	return result, nil
+}
+
+func (host *GiteaHost) CreateRelease(slug string, tag string, body string) (Release, error) {
+	opts := gitea.CreateReleaseOption{TagName: tag, Note: body}
+	release, _, err := host.client.CreateRelease(host.owner, slug, opts)
+	if err != nil {
+		return Release{}, err
+	}
+	return Release{ID: release.ID, TagName: release.TagName}, nil
+}
+
+func (host *GiteaHost) UploadAsset(slug string, release_id int64, asset_path string) error {
+	fh, err := os.Open(asset_path)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	_, _, err = host.client.CreateReleaseAttachment(host.owner, slug, release_id, fh, filepath.Base(asset_path))
+	return err
+}
+
+func (host *GiteaHost) DeleteRelease(slug string, release_id int64) error {
+	_, err := host.client.DeleteRelease(host.owner, slug, release_id)
+	return err
+}
+
+func (host *GiteaHost) CloneURL(slug string) string {
+	return fmt.Sprintf(host.clone_url_template, host.owner, slug)
+}
+
+// LatestReleaseTags has no GraphQL equivalent to batch over on Gitea, so it
+// falls back to one `ListReleases` call per slug.
+func (host *GiteaHost) LatestReleaseTags(slug_list []string) (map[string]string, error) {
+	result := map[string]string{}
+	for _, slug := range slug_list {
+		release_list, err := host.ListReleases(slug)
+		if err != nil {
+			return nil, err
+		}
+		if len(release_list) == 0 {
+			continue
+		}
+		result[slug] = release_list[0].TagName
+	}
+	return result, nil
+}
@@ -0,0 +1,76 @@
+/*
+   Copyright (C) 2023 Torkus
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as
+   published by the Free Software Foundation, either version 3 of the
+   License, or (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v52/github"
+)
+
+func TestWithRateLimitRetryPassesThroughOnSuccess(t *testing.T) {
+	calls := 0
+	err := with_rate_limit_retry(func() error {
+		calls++
+		return nil
+	})
+	if err != nil {
+		t.Errorf("with_rate_limit_retry(...) = %v, want nil", err)
+	}
+	if calls != 1 {
+		t.Errorf("fn called %d times, want 1", calls)
+	}
+}
+
+func TestWithRateLimitRetryPassesThroughNonRateLimitErrors(t *testing.T) {
+	want_err := errors.New("boom")
+	calls := 0
+	err := with_rate_limit_retry(func() error {
+		calls++
+		return want_err
+	})
+	if err != want_err {
+		t.Errorf("with_rate_limit_retry(...) = %v, want %v", err, want_err)
+	}
+	if calls != 1 {
+		t.Errorf("fn called %d times, want 1 (no retry on a non-rate-limit error)", calls)
+	}
+}
+
+func TestWithRateLimitRetryRetriesOnceAfterRateLimitError(t *testing.T) {
+	rate_limit_err := &github.RateLimitError{
+		Rate: github.Rate{Reset: github.Timestamp{Time: time.Now().Add(-time.Minute)}},
+	}
+
+	calls := 0
+	err := with_rate_limit_retry(func() error {
+		calls++
+		if calls == 1 {
+			return rate_limit_err
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("with_rate_limit_retry(...) = %v, want nil", err)
+	}
+	if calls != 2 {
+		t.Errorf("fn called %d times, want 2 (one retry after the rate-limit error)", calls)
+	}
+}
@@ -0,0 +1,135 @@
+/*
+   Copyright (C) 2023 Torkus
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as
+   published by the Free Software Foundation, either version 3 of the
+   License, or (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// matches changelog version headers, eg "## 13.33", "# v13.33 (2023-09-01)".
+var changelog_header_regexp = regexp.MustCompile(`(?m)^(#{1,3})\s*v?([0-9][0-9A-Za-z.\-]*)`)
+
+// names (case-insensitive, basename only) build_release_notes looks for inside
+// the downloaded zip when hunting for a changelog.
+var changelog_filename_list = []string{"changelog.md", "changelog.txt"}
+
+// builds the markdown body for a mirrored release: a one-line version bump
+// summary, followed by the matching section of the addon's own changelog (if
+// one can be found in the zip at `zip_path`) or, failing that, a templated
+// summary of the flavours this release supports.
+func build_release_notes(addon Addon, prev_version string, new_version string, zip_path string) string {
+	section := extract_changelog_section(zip_path, new_version)
+	if section == "" {
+		section = templated_flavour_summary(addon.PatchList)
+	}
+	return version_diff_summary(prev_version, new_version) + "\n\n" + section
+}
+
+func version_diff_summary(prev_version string, new_version string) string {
+	if prev_version == "" {
+		return fmt.Sprintf("First mirrored release (`%s`).", new_version)
+	}
+	return fmt.Sprintf("Updated from `%s` to `%s`.", prev_version, new_version)
+}
+
+// lists the flavours and interface versions supported by this release, derived
+// from the addon's `PatchList`. used as release notes when no changelog
+// section can be found.
+func templated_flavour_summary(patch_list []string) string {
+	lines := []string{"Supported flavours:"}
+	for _, patch := range patch_list {
+		flavour := patch_to_flavour(patch)
+		iface := patch_to_interface(patch)
+		lines = append(lines, fmt.Sprintf("- %s (interface `%d`, patch `%s`)", flavour, iface, patch))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// returns the section of a CHANGELOG.md/changelog.txt file inside the zip at
+// `zip_path` whose header matches `version`, or "" if the zip can't be read,
+// has no changelog, or no section matches.
+func extract_changelog_section(zip_path string, version string) string {
+	reader, err := zip.OpenReader(zip_path)
+	if err != nil {
+		return ""
+	}
+	defer reader.Close()
+
+	changelog_file := find_changelog_file(reader.File)
+	if changelog_file == nil {
+		return ""
+	}
+
+	fh, err := changelog_file.Open()
+	if err != nil {
+		return ""
+	}
+	defer fh.Close()
+
+	content_bytes, err := io.ReadAll(fh)
+	if err != nil {
+		return ""
+	}
+
+	return changelog_section_for_version(string(content_bytes), version)
+}
+
+func find_changelog_file(file_list []*zip.File) *zip.File {
+	for _, file := range file_list {
+		base := strings.ToLower(file_name_base(file.Name))
+		for _, name := range changelog_filename_list {
+			if base == name {
+				return file
+			}
+		}
+	}
+	return nil
+}
+
+// "Interface/AddOn/CHANGELOG.md" => "CHANGELOG.md"
+func file_name_base(path string) string {
+	bits := strings.Split(path, "/")
+	return bits[len(bits)-1]
+}
+
+// extracts the section of `content` headed by a line matching `version`, up
+// to (but not including) the next header of equal or higher precedence.
+func changelog_section_for_version(content string, version string) string {
+	match_list := changelog_header_regexp.FindAllStringSubmatchIndex(content, -1)
+	for i, match := range match_list {
+		header_version := content[match[4]:match[5]]
+		if header_version != version {
+			continue
+		}
+		level := match[3] - match[2] // number of leading '#'
+		start := match[0]
+		end := len(content)
+		for _, next := range match_list[i+1:] {
+			if next[3]-next[2] <= level {
+				end = next[0]
+				break
+			}
+		}
+		return strings.TrimSpace(content[start:end])
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+/*
+   Copyright (C) 2023 Torkus
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as
+   published by the Free Software Foundation, either version 3 of the
+   License, or (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import "testing"
+
+func TestChangelogSectionForVersion(t *testing.T) {
+	content := `# Changelog
+
+## 13.34
+- fixed a thing
+
+## v13.33 (2023-09-01)
+- added a thing
+- tweaked another thing
+
+# 13.32
+- initial mainline release
+`
+
+	cases := []struct {
+		name    string
+		version string
+		want    string
+	}{
+		{
+			name:    "matches a header without a 'v' prefix",
+			version: "13.34",
+			want:    "## 13.34\n- fixed a thing",
+		},
+		{
+			name:    "matches a header with a 'v' prefix",
+			version: "13.33",
+			want:    "## v13.33 (2023-09-01)\n- added a thing\n- tweaked another thing",
+		},
+		{
+			name:    "the last section in the file runs to EOF",
+			version: "13.32",
+			want:    "# 13.32\n- initial mainline release",
+		},
+		{
+			name:    "no matching header returns empty",
+			version: "99.99",
+			want:    "",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := changelog_section_for_version(content, c.version)
+			if got != c.want {
+				t.Errorf("changelog_section_for_version(content, %q) = %q, want %q", c.version, got, c.want)
+			}
+		})
+	}
+}
+
+func TestChangelogSectionForVersionNoHeaders(t *testing.T) {
+	got := changelog_section_for_version("just some notes, no headers at all", "1.0")
+	if got != "" {
+		t.Errorf("expected no match against a changelog with no headers, got %q", got)
+	}
+}